@@ -0,0 +1,171 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package controlclient
+
+import (
+	"errors"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+// ErrMissingFullMapResponse is returned by MapSession.Apply when an
+// incremental MapResponse arrives before the session has a cached full
+// netmap to apply it to. Callers should fall back to a full resync (a
+// MapRequest with OmitPeers cleared) rather than treat this as fatal.
+var ErrMissingFullMapResponse = errors.New("controlclient: incremental MapResponse received without a prior full netmap")
+
+// ErrNetmapGap is returned by MapSession.Apply when a MapResponse's Seq
+// isn't the one immediately following the last response this session
+// applied, meaning at least one response was dropped in between. The
+// client's cached netmap can no longer be trusted to reflect the deltas
+// it didn't see, so callers should fall back to a full resync rather than
+// keep applying incremental updates to a possibly-stale cache.
+var ErrNetmapGap = errors.New("controlclient: MapResponse sequence gap; full resync required")
+
+// MapSession folds a stream of tailcfg.MapResponse values into a single
+// current view of the tailnet's peers, so that callers don't need to
+// special-case full versus incremental (patch) responses from the control
+// plane. It's exported so that other consumers of the same MapResponse
+// stream (e.g. ipnserver's status reporting) can merge updates with the
+// same semantics as the control client, rather than reading resp.Peers
+// directly and missing incremental-only updates.
+type MapSession struct {
+	have      bool // whether a full netmap has been received yet
+	seq       int64
+	order     []tailcfg.NodeID
+	byID      map[tailcfg.NodeID]*tailcfg.Node
+	updatedAt map[tailcfg.NodeID]time.Time // last-applied PeersUpdatedAt, for coalescing
+}
+
+// NewMapSession returns a new, empty MapSession.
+func NewMapSession() *MapSession {
+	return &MapSession{
+		byID:      map[tailcfg.NodeID]*tailcfg.Node{},
+		updatedAt: map[tailcfg.NodeID]time.Time{},
+	}
+}
+
+// staleUpdate reports whether resp's update for id is older than one
+// MapSession has already applied and so should be dropped rather than
+// clobber newer state. Nodes resp doesn't timestamp (PeersUpdatedAt has no
+// entry for them) are never considered stale, since there's nothing to
+// compare against.
+func (ms *MapSession) staleUpdate(resp *tailcfg.MapResponse, id tailcfg.NodeID) bool {
+	at, ok := resp.PeersUpdatedAt[id]
+	if !ok {
+		return false
+	}
+	prev, ok := ms.updatedAt[id]
+	if ok && at.Before(prev) {
+		return true
+	}
+	ms.updatedAt[id] = at
+	return false
+}
+
+// Netmap returns the current set of peers, in the order the control plane
+// last sent them (full responses establish the order; incremental changes
+// are appended).
+func (ms *MapSession) Netmap() []*tailcfg.Node {
+	peers := make([]*tailcfg.Node, 0, len(ms.order))
+	for _, id := range ms.order {
+		if n, ok := ms.byID[id]; ok {
+			peers = append(peers, n)
+		}
+	}
+	return peers
+}
+
+func (ms *MapSession) setFull(peers []*tailcfg.Node) {
+	ms.byID = make(map[tailcfg.NodeID]*tailcfg.Node, len(peers))
+	ms.order = make([]tailcfg.NodeID, 0, len(peers))
+	for _, n := range peers {
+		ms.byID[n.ID] = n
+		ms.order = append(ms.order, n.ID)
+	}
+	ms.have = true
+}
+
+func (ms *MapSession) upsert(n *tailcfg.Node) {
+	if _, ok := ms.byID[n.ID]; !ok {
+		ms.order = append(ms.order, n.ID)
+	}
+	ms.byID[n.ID] = n
+}
+
+func (ms *MapSession) remove(id tailcfg.NodeID) {
+	if _, ok := ms.byID[id]; !ok {
+		return
+	}
+	delete(ms.byID, id)
+	for i, oid := range ms.order {
+		if oid == id {
+			ms.order = append(ms.order[:i], ms.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Apply merges resp into ms and returns the resulting full peer list.
+//
+// A MapResponse with a non-nil Peers establishes (or replaces) the full
+// netmap. One with a nil Peers is treated as incremental: PeersChanged and
+// PeersRemoved are applied against the cached netmap, and PeersChangedPatch
+// is applied as small per-field diffs on top of that. If no full netmap has
+// been cached yet, an incremental-only response can't be applied and Apply
+// returns ErrMissingFullMapResponse. If resp.Seq doesn't immediately follow
+// the last response applied, at least one response was missed and Apply
+// returns ErrNetmapGap instead of applying deltas against a stale cache.
+func (ms *MapSession) Apply(resp *tailcfg.MapResponse) ([]*tailcfg.Node, error) {
+	if err := checkServerCapability(resp); err != nil {
+		return nil, err
+	}
+	if resp.Peers != nil {
+		ms.setFull(resp.Peers)
+		ms.seq = resp.Seq
+		return ms.Netmap(), nil
+	}
+	if !ms.have {
+		return nil, ErrMissingFullMapResponse
+	}
+	if resp.Seq != ms.seq+1 {
+		return nil, ErrNetmapGap
+	}
+	ms.seq = resp.Seq
+	for _, n := range resp.PeersChanged {
+		if ms.staleUpdate(resp, n.ID) {
+			continue
+		}
+		ms.upsert(n)
+	}
+	for _, id := range resp.PeersRemoved {
+		ms.remove(id)
+	}
+	for _, pc := range resp.PeersChangedPatch {
+		if ms.staleUpdate(resp, pc.NodeID) {
+			continue
+		}
+		cur, ok := ms.byID[pc.NodeID]
+		if !ok {
+			continue
+		}
+		n := cur.Clone()
+		if pc.DERP != nil {
+			n.DERP = *pc.DERP
+		}
+		if pc.Endpoints != nil {
+			n.Endpoints = pc.Endpoints
+		}
+		if pc.Online != nil {
+			n.Online = pc.Online
+		}
+		if pc.LastSeen != nil {
+			n.LastSeen = pc.LastSeen
+		}
+		ms.byID[pc.NodeID] = n
+	}
+	return ms.Netmap(), nil
+}
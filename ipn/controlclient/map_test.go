@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package controlclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+func n(id tailcfg.NodeID, derp string, online bool) *tailcfg.Node {
+	o := online
+	return &tailcfg.Node{ID: id, DERP: derp, Online: &o}
+}
+
+// resp fills in a current ServerCapabilityVersion so tests can otherwise
+// ignore the compatibility gate in checkServerCapability.
+func resp(r tailcfg.MapResponse) *tailcfg.MapResponse {
+	r.ServerCapabilityVersion = tailcfg.CurrentCapabilityVersion
+	return &r
+}
+
+func TestMapSessionIncrementalMatchesFull(t *testing.T) {
+	full1 := resp(tailcfg.MapResponse{
+		Peers: []*tailcfg.Node{
+			n(1, "derp1", true),
+			n(2, "derp1", true),
+			n(3, "derp2", false),
+		},
+	})
+
+	// Build up the same end state two ways: one full MapResponse, and a
+	// stream of incremental patches applied on top of an earlier full
+	// response. They must converge to the same netmap.
+	incremental := NewMapSession()
+	if _, err := incremental.Apply(full1); err != nil {
+		t.Fatalf("initial full apply: %v", err)
+	}
+
+	derp3 := "derp3"
+	offline := false
+	lastSeen := time.Unix(1, 0).UTC()
+	patches := []*tailcfg.MapResponse{
+		resp(tailcfg.MapResponse{Seq: 1, PeersChangedPatch: []tailcfg.PeerChange{{NodeID: 1, DERP: &derp3}}}),
+		resp(tailcfg.MapResponse{Seq: 2, PeersChangedPatch: []tailcfg.PeerChange{{NodeID: 3, Online: boolPtr(true)}}}),
+		resp(tailcfg.MapResponse{Seq: 3, PeersRemoved: []tailcfg.NodeID{2}}),
+		resp(tailcfg.MapResponse{Seq: 4, PeersChanged: []*tailcfg.Node{n(4, "derp1", true)}}),
+		resp(tailcfg.MapResponse{Seq: 5, PeersChangedPatch: []tailcfg.PeerChange{{NodeID: 4, Online: &offline, LastSeen: &lastSeen}}}),
+	}
+	for _, p := range patches {
+		if _, err := incremental.Apply(p); err != nil {
+			t.Fatalf("incremental apply: %v", err)
+		}
+	}
+
+	want := resp(tailcfg.MapResponse{
+		Peers: []*tailcfg.Node{
+			n(1, "derp3", true),
+			n(3, "derp2", true),
+			{ID: 4, DERP: "derp1", Online: &offline, LastSeen: &lastSeen},
+		},
+	})
+	fromFull := NewMapSession()
+	gotFull, err := fromFull.Apply(want)
+	if err != nil {
+		t.Fatalf("full apply: %v", err)
+	}
+
+	gotIncremental := incremental.Netmap()
+	if !nodesEqual(gotIncremental, gotFull) {
+		t.Errorf("incremental netmap differs from full netmap\n incremental: %+v\n full:        %+v", gotIncremental, gotFull)
+	}
+}
+
+func TestMapSessionDetectsGap(t *testing.T) {
+	ms := NewMapSession()
+	if _, err := ms.Apply(resp(tailcfg.MapResponse{Seq: 0, Peers: []*tailcfg.Node{n(1, "derp1", true)}})); err != nil {
+		t.Fatalf("initial full apply: %v", err)
+	}
+	// Seq 2 arrives without Seq 1 ever having been applied: a dropped
+	// response in between means our cache can't be trusted against this
+	// delta.
+	_, err := ms.Apply(resp(tailcfg.MapResponse{Seq: 2, PeersRemoved: []tailcfg.NodeID{1}}))
+	if !errors.Is(err, ErrNetmapGap) {
+		t.Fatalf("apply error = %v; want ErrNetmapGap", err)
+	}
+}
+
+func TestMapSessionDropsStaleUpdate(t *testing.T) {
+	ms := NewMapSession()
+	if _, err := ms.Apply(resp(tailcfg.MapResponse{Seq: 0, Peers: []*tailcfg.Node{n(1, "derp1", true)}})); err != nil {
+		t.Fatalf("initial full apply: %v", err)
+	}
+
+	newer := "derp-new"
+	older := "derp-old"
+	t1 := time.Unix(100, 0).UTC()
+	t0 := time.Unix(50, 0).UTC()
+
+	// A patch timestamped earlier than one already applied for the same
+	// node must be coalesced away (dropped), not clobber the newer state
+	// that already landed — e.g. because it was redelivered out of order.
+	if _, err := ms.Apply(resp(tailcfg.MapResponse{
+		Seq:               1,
+		PeersChangedPatch: []tailcfg.PeerChange{{NodeID: 1, DERP: &newer}},
+		PeersUpdatedAt:    map[tailcfg.NodeID]time.Time{1: t1},
+	})); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if _, err := ms.Apply(resp(tailcfg.MapResponse{
+		Seq:               2,
+		PeersChangedPatch: []tailcfg.PeerChange{{NodeID: 1, DERP: &older}},
+		PeersUpdatedAt:    map[tailcfg.NodeID]time.Time{1: t0},
+	})); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	got := ms.Netmap()
+	if len(got) != 1 || got[0].DERP != newer {
+		t.Errorf("netmap = %+v; want single peer with DERP %q", got, newer)
+	}
+}
+
+func TestMapSessionRequiresFullBeforeIncremental(t *testing.T) {
+	ms := NewMapSession()
+	_, err := ms.Apply(resp(tailcfg.MapResponse{PeersChanged: []*tailcfg.Node{n(1, "derp1", true)}}))
+	if err != ErrMissingFullMapResponse {
+		t.Fatalf("apply error = %v; want ErrMissingFullMapResponse", err)
+	}
+}
+
+func TestMapSessionAcceptsLegacyServer(t *testing.T) {
+	// A MapResponse with the zero value of ServerCapabilityVersion is what
+	// every control server sends until it's upgraded to stamp this field;
+	// it must not be rejected as "too old".
+	ms := NewMapSession()
+	if _, err := ms.Apply(&tailcfg.MapResponse{Peers: []*tailcfg.Node{n(1, "derp1", true)}}); err != nil {
+		t.Fatalf("apply of legacy (zero ServerCapabilityVersion) response: %v", err)
+	}
+}
+
+func TestMapSessionRejectsOldServer(t *testing.T) {
+	ms := NewMapSession()
+	_, err := ms.Apply(&tailcfg.MapResponse{
+		Peers:                   []*tailcfg.Node{n(1, "derp1", true)},
+		ServerCapabilityVersion: MinSupportedCapabilityVersion - 1,
+	})
+	if !errors.Is(err, ErrServerTooOld) {
+		t.Fatalf("apply error = %v; want ErrServerTooOld", err)
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+// nodesEqual reports whether a and b contain the same nodes, by
+// Node.Equal, in the same order. Unlike comparing a lossy per-field
+// projection, this catches divergence in any field Node.Equal considers,
+// not just the handful a test author happened to think to check.
+func nodesEqual(a, b []*tailcfg.Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
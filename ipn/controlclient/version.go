@@ -0,0 +1,37 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package controlclient
+
+import (
+	"errors"
+	"fmt"
+
+	"tailscale.com/tailcfg"
+)
+
+// MinSupportedCapabilityVersion is the lowest tailcfg.CapabilityVersion
+// this client will speak to. It is deliberately kept low (below
+// tailcfg.CurrentCapabilityVersion) so that control servers which haven't
+// been upgraded yet — including every server running today, which predates
+// this field and so sends the zero value — keep working. Raise it only
+// when a specific old capability level (e.g. a pre-Noise-era key encoding)
+// is actually being dropped from the codebase, not on every capability
+// bump.
+const MinSupportedCapabilityVersion tailcfg.CapabilityVersion = 0
+
+// ErrServerTooOld is returned by checkServerCapability when the control
+// server's advertised tailcfg.MapResponse.ServerCapabilityVersion is below
+// MinSupportedCapabilityVersion. MapSession.Apply returns it (wrapped, so
+// match it with errors.Is) before applying anything from such a response.
+var ErrServerTooOld = errors.New("controlclient: control server's capability version is too old for this client")
+
+// checkServerCapability reports whether resp was sent by a control server
+// new enough for this client to talk to, returning ErrServerTooOld if not.
+func checkServerCapability(resp *tailcfg.MapResponse) error {
+	if resp.ServerCapabilityVersion < MinSupportedCapabilityVersion {
+		return fmt.Errorf("%w: server=%d client requires>=%d", ErrServerTooOld, resp.ServerCapabilityVersion, MinSupportedCapabilityVersion)
+	}
+	return nil
+}
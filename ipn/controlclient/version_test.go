@@ -0,0 +1,35 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package controlclient
+
+import (
+	"errors"
+	"testing"
+
+	"tailscale.com/tailcfg"
+)
+
+func TestCheckServerCapability(t *testing.T) {
+	tests := []struct {
+		name string
+		cv   tailcfg.CapabilityVersion
+		want bool // true if it should be accepted
+	}{
+		{"too_old", MinSupportedCapabilityVersion - 1, false},
+		{"exact_min", MinSupportedCapabilityVersion, true},
+		{"newer", MinSupportedCapabilityVersion + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkServerCapability(&tailcfg.MapResponse{ServerCapabilityVersion: tt.cv})
+			if got := err == nil; got != tt.want {
+				t.Errorf("checkServerCapability(%d) ok=%v, err=%v; want ok=%v", tt.cv, got, err, tt.want)
+			}
+			if err != nil && !errors.Is(err, ErrServerTooOld) {
+				t.Errorf("err = %v; want wrapping ErrServerTooOld", err)
+			}
+		})
+	}
+}
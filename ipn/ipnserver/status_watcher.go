@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipnserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn/controlclient"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/systemd"
+)
+
+// StatusWatcher consumes a stream of tailcfg.MapResponse updates (as
+// received from the control client) and keeps systemd's view of this
+// process current: systemd.Ready once the first netmap arrives,
+// systemd.Status with a human-readable summary on every applied update
+// (that first one included), and a systemd.Watchdog keepalive until the
+// context passed to Run is done, whether or not updates keep arriving.
+//
+// Updates are folded through a controlclient.MapSession of its own, the
+// same merge logic the control client itself uses, so that an
+// incremental-only update (e.g. a PeersChangedPatch flipping one peer
+// offline) is reflected in the status line instead of being ignored
+// because it carries no full Peers list.
+type StatusWatcher struct {
+	notifyReady  func() error
+	notifyStatus func(string) error
+	mapSession   *controlclient.MapSession
+
+	mu       sync.Mutex
+	ready    bool
+	lastSeen time.Time
+	netInfo  *tailcfg.NetInfo
+}
+
+// NewStatusWatcher returns a StatusWatcher that reports to the real systemd
+// package.
+func NewStatusWatcher() *StatusWatcher {
+	return &StatusWatcher{
+		notifyReady:  systemd.Ready,
+		notifyStatus: systemd.Status,
+		mapSession:   controlclient.NewMapSession(),
+	}
+}
+
+// Run consumes updates until ctx is done or updates is closed, blocking
+// until then. Each MapResponse sent on updates is applied in arrival order.
+func (w *StatusWatcher) Run(ctx context.Context, updates <-chan *tailcfg.MapResponse) {
+	go systemd.Watchdog(ctx, w.healthCheck)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case resp, ok := <-updates:
+			if !ok {
+				return
+			}
+			w.apply(resp)
+		}
+	}
+}
+
+func (w *StatusWatcher) apply(resp *tailcfg.MapResponse) {
+	peers, err := w.mapSession.Apply(resp)
+	if err != nil {
+		// The merge failed — e.g. a dropped response left a sequence gap —
+		// so resp can't be trusted to update our view of the netmap. Leave
+		// the last known-good status in place rather than report a netmap
+		// we know is wrong; a full resync will recover it.
+		return
+	}
+
+	w.mu.Lock()
+	w.lastSeen = time.Now()
+	if resp.Node != nil && resp.Node.Hostinfo.NetInfo != nil {
+		w.netInfo = resp.Node.Hostinfo.NetInfo
+	}
+	ready := w.ready
+	w.ready = true
+	line := systemdStatusLine(w.netInfo, peers)
+	w.mu.Unlock()
+
+	if !ready {
+		w.notifyReady()
+	}
+	w.notifyStatus(line)
+}
+
+// healthCheck reports an error if no netmap update has ever been applied,
+// so that the STATUS line systemd.Watchdog sends reflects a server that's
+// started but hasn't heard from control yet. The watchdog keepalive itself
+// is sent either way.
+func (w *StatusWatcher) healthCheck() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lastSeen.IsZero() {
+		return errors.New("ipnserver: no netmap received yet")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipnserver
+
+import (
+	"context"
+	"testing"
+
+	"tailscale.com/ipn/controlclient"
+	"tailscale.com/tailcfg"
+)
+
+func newTestStatusWatcher() (*StatusWatcher, *int, *[]string) {
+	readyCount := 0
+	var statusLines []string
+	w := &StatusWatcher{
+		notifyReady:  func() error { readyCount++; return nil },
+		notifyStatus: func(s string) error { statusLines = append(statusLines, s); return nil },
+		mapSession:   controlclient.NewMapSession(),
+	}
+	return w, &readyCount, &statusLines
+}
+
+func TestStatusWatcherRun(t *testing.T) {
+	w, readyCount, statusLines := newTestStatusWatcher()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan *tailcfg.MapResponse)
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, updates)
+		close(done)
+	}()
+
+	online := true
+	updates <- &tailcfg.MapResponse{
+		Node:  &tailcfg.Node{Hostinfo: tailcfg.Hostinfo{NetInfo: &tailcfg.NetInfo{PreferredDERP: 2}}},
+		Peers: []*tailcfg.Node{{ID: 1, Online: &online}},
+	}
+	// A PeersChangedPatch taking that peer offline is the same
+	// incremental-only traffic the control plane uses to avoid resending
+	// the full peer list on every change; it must flow through the status
+	// line too, not just full responses.
+	offline := false
+	updates <- &tailcfg.MapResponse{
+		Seq:               1,
+		PeersChangedPatch: []tailcfg.PeerChange{{NodeID: 1, Online: &offline}},
+	}
+
+	close(updates)
+	<-done
+
+	if *readyCount != 1 {
+		t.Errorf("notifyReady called %d times; want 1", *readyCount)
+	}
+	want := []string{
+		"1/1 peers online, preferred DERP derp2",
+		"0/1 peers online, preferred DERP derp2",
+	}
+	if len(*statusLines) != len(want) {
+		t.Fatalf("statusLines = %v; want %v", *statusLines, want)
+	}
+	for i, got := range *statusLines {
+		if got != want[i] {
+			t.Errorf("statusLines[%d] = %q; want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestStatusWatcherHealthCheck(t *testing.T) {
+	w, _, _ := newTestStatusWatcher()
+	if err := w.healthCheck(); err == nil {
+		t.Error("healthCheck = nil before any update; want error")
+	}
+	w.apply(&tailcfg.MapResponse{Peers: []*tailcfg.Node{}})
+	if err := w.healthCheck(); err != nil {
+		t.Errorf("healthCheck = %v after an update; want nil", err)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipnserver
+
+import (
+	"fmt"
+
+	"tailscale.com/tailcfg"
+)
+
+// systemdStatusLine summarizes the current netmap into the one-line form
+// that's passed to systemd.Status, so that `systemctl status tailscaled`
+// shows something operators can actually act on instead of just "running".
+func systemdStatusLine(netInfo *tailcfg.NetInfo, peers []*tailcfg.Node) string {
+	online := 0
+	for _, p := range peers {
+		if p.Online != nil && *p.Online {
+			online++
+		}
+	}
+	derp := "unknown"
+	if netInfo != nil && netInfo.PreferredDERP != 0 {
+		derp = fmt.Sprintf("derp%d", netInfo.PreferredDERP)
+	}
+	return fmt.Sprintf("%d/%d peers online, preferred DERP %s", online, len(peers), derp)
+}
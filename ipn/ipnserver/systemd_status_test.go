@@ -0,0 +1,34 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipnserver
+
+import (
+	"testing"
+
+	"tailscale.com/tailcfg"
+)
+
+func TestSystemdStatusLine(t *testing.T) {
+	online := true
+	offline := false
+	peers := []*tailcfg.Node{
+		{ID: 1, Online: &online},
+		{ID: 2, Online: &offline},
+		{ID: 3},
+	}
+	got := systemdStatusLine(&tailcfg.NetInfo{PreferredDERP: 5}, peers)
+	want := "1/3 peers online, preferred DERP derp5"
+	if got != want {
+		t.Errorf("systemdStatusLine = %q; want %q", got, want)
+	}
+}
+
+func TestSystemdStatusLineNoNetInfo(t *testing.T) {
+	got := systemdStatusLine(nil, nil)
+	want := "0/0 peers online, preferred DERP unknown"
+	if got != want {
+		t.Errorf("systemdStatusLine = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tailcfg contains types used by the control plane and clients to
+// describe the state of a tailnet: users, nodes, and the map responses that
+// describe how they are allowed to talk to each other.
+package tailcfg
+
+//go:generate go run tailscale.com/cmd/cloner -type=User,Node,Hostinfo -output=tailcfg_clone.go
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"inet.af/netaddr"
+	"tailscale.com/types/opt"
+)
+
+type ID int64
+
+type UserID ID
+
+type LoginID ID
+
+type NodeID ID
+
+// StableID is an identifier for an object (typically a Node) that remains
+// stable across renames and key rotations.
+type StableID string
+
+// User is an IPN user, usually a Google or Microsoft account.
+type User struct {
+	ID            UserID
+	LoginName     string `json:"-"` // not stored, filled from Login
+	DisplayName   string // if non-empty, the Login.DisplayName
+	ProfilePicURL string `json:"-"` // if non-empty, the Login.ProfilePicURL
+	Domain        string
+	Logins        []LoginID
+	Created       time.Time
+}
+
+// Node is a Tailscale device or service (such as a subnet router) in a
+// tailnet.
+type Node struct {
+	ID       NodeID
+	StableID StableID
+	Name     string // full DNS name of the node, e.g. "host.tailnet.ts.net."
+
+	// DisplayName is a friendly name for the node, set by the user in the
+	// admin console. It defaults to the hostname if not otherwise set.
+	DisplayName string
+	User        UserID
+	Sharer      NodeID `json:",omitempty"` // if non-zero, the user who shared this node to User
+
+	Key       NodeKey
+	KeyExpiry time.Time
+	Machine   MachineKey
+	DiscoKey  DiscoKey
+
+	Addresses  []netaddr.IPPrefix // IP addresses of this Node directly
+	AllowedIPs []netaddr.IPPrefix // range of IP addresses to route to this node
+	Endpoints  []string           `json:",omitempty"` // IP+port (public via STUN, and local LANs)
+	DERP       string             `json:",omitempty"` // DERP-in-Go server: "region.derp" or "IP:port"
+	Hostinfo   Hostinfo
+
+	Created  time.Time
+	LastSeen *time.Time `json:",omitempty"` // last seen to tailcontrol, for the HTTP poller only
+
+	KeepAlive         bool // open and keep open a connection to this peer
+	MachineAuthorized bool // true iff the node's machine key is authorized
+
+	// Online reports whether the node was recently connected to the control
+	// plane, as best known by the control plane at the time the MapResponse
+	// was generated. It is updated independently of LastSeen, which only
+	// advances on disconnect, so Online is the field to use to decide
+	// whether a peer is currently reachable rather than merely "was seen
+	// before". A nil value means the control server doesn't know, or
+	// doesn't support reporting presence, and callers should fall back to
+	// LastSeen heuristics.
+	Online *bool `json:",omitempty"`
+
+	// IsSubnetRouterPrimary is set by the control plane, never by the node
+	// itself, to tell this node it currently owns all of its
+	// Hostinfo.RoutableIPs prefixes and should NAT/route traffic for them.
+	// Standby HA routers advertise the same RoutableIPs but leave this
+	// false. It lives on Node rather than on the client-authored Hostinfo
+	// so that a client echoing back its last-received Hostinfo in a
+	// MapRequest can never resend a control-assigned election result as if
+	// it were its own claim.
+	IsSubnetRouterPrimary bool `json:",omitempty"`
+}
+
+func eqBoolPtr(a, b *bool) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	return *a == *b
+}
+
+func eqTimePtr(a, b *time.Time) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Equal(*b)
+}
+
+func eqStringSlice(a, b []string) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func eqIPPrefixSlice(a, b []netaddr.IPPrefix) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether n and n2 are equal.
+func (n *Node) Equal(n2 *Node) bool {
+	if n == nil && n2 == nil {
+		return true
+	}
+	if (n == nil) != (n2 == nil) {
+		return false
+	}
+	return n.ID == n2.ID &&
+		n.StableID == n2.StableID &&
+		n.Name == n2.Name &&
+		n.DisplayName == n2.DisplayName &&
+		n.User == n2.User &&
+		n.Sharer == n2.Sharer &&
+		n.Key == n2.Key &&
+		n.KeyExpiry.Equal(n2.KeyExpiry) &&
+		n.Machine == n2.Machine &&
+		n.DiscoKey == n2.DiscoKey &&
+		eqIPPrefixSlice(n.Addresses, n2.Addresses) &&
+		eqIPPrefixSlice(n.AllowedIPs, n2.AllowedIPs) &&
+		eqStringSlice(n.Endpoints, n2.Endpoints) &&
+		n.DERP == n2.DERP &&
+		n.Hostinfo.Equal(&n2.Hostinfo) &&
+		n.Created.Equal(n2.Created) &&
+		eqTimePtr(n.LastSeen, n2.LastSeen) &&
+		n.KeepAlive == n2.KeepAlive &&
+		n.MachineAuthorized == n2.MachineAuthorized &&
+		eqBoolPtr(n.Online, n2.Online) &&
+		n.IsSubnetRouterPrimary == n2.IsSubnetRouterPrimary
+}
+
+// Hostinfo contains a summary of a Tailscale host's configuration and
+// capabilities, as reported by the node itself.
+type Hostinfo struct {
+	IPNVersion    string // version of this code
+	FrontendLogID string // logtail ID of frontend instance
+	BackendLogID  string // logtail ID of backend instance
+	OS            string // operating system the client runs on
+	OSVersion     string // operating system version, as a string
+	DeviceModel   string // mobile device model ("Pixel 3a")
+	Hostname      string // name of the host the client runs on
+	ShieldsUp     bool   // indicates whether the host is blocking incoming connections
+	ShareeNode    bool   `json:",omitempty"` // indicates this node exists in the netmap because it's owned by a shared-to user
+	GoArch        string // architecture of the Go runtime
+
+	RoutableIPs []netaddr.IPPrefix `json:",omitempty"` // set of IP ranges this node wants to route
+	RequestTags []string           `json:",omitempty"` // set of ACL tags this node wants to claim
+
+	Services []Service `json:",omitempty"` // services advertised by this machine
+	NetInfo  *NetInfo  `json:",omitempty"`
+
+	// RoutableIPsPriority, if non-nil, gives this node's preference for
+	// being the primary advertiser of each of its RoutableIPs prefixes,
+	// higher winning, when more than one subnet router advertises the
+	// same prefix for HA. Prefixes absent from the map are treated as
+	// priority 0.
+	RoutableIPsPriority map[netaddr.IPPrefix]int `json:",omitempty"`
+}
+
+// Service represents a service running on a node.
+type Service struct {
+	Proto       ServiceProto
+	Port        uint16
+	Description string `json:",omitempty"`
+}
+
+// ServiceProto is a service protocol, such as "tcp" or "udp".
+type ServiceProto string
+
+const (
+	TCP = ServiceProto("tcp")
+	UDP = ServiceProto("udp")
+)
+
+// NetInfo contains information about the host's network state.
+type NetInfo struct {
+	MappingVariesByDestIP bool
+	HairPinning           opt.Bool
+	WorkingIPv6           bool
+	WorkingUDP            bool
+	UPnP                  opt.Bool
+	PMP                   opt.Bool
+	PCP                   opt.Bool
+	PreferredDERP         int
+	LinkType              string
+	DERPLatency           map[string]float64
+}
+
+func eqRoutePriorityMap(a, b map[netaddr.IPPrefix]int) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func eqServiceSlice(a, b []Service) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether h and h2 are equal.
+func (h *Hostinfo) Equal(h2 *Hostinfo) bool {
+	if h == nil && h2 == nil {
+		return true
+	}
+	if (h == nil) != (h2 == nil) {
+		return false
+	}
+	return h.IPNVersion == h2.IPNVersion &&
+		h.FrontendLogID == h2.FrontendLogID &&
+		h.BackendLogID == h2.BackendLogID &&
+		h.OS == h2.OS &&
+		h.OSVersion == h2.OSVersion &&
+		h.DeviceModel == h2.DeviceModel &&
+		h.Hostname == h2.Hostname &&
+		h.ShieldsUp == h2.ShieldsUp &&
+		h.ShareeNode == h2.ShareeNode &&
+		h.GoArch == h2.GoArch &&
+		eqIPPrefixSlice(h.RoutableIPs, h2.RoutableIPs) &&
+		eqStringSlice(h.RequestTags, h2.RequestTags) &&
+		eqServiceSlice(h.Services, h2.Services) &&
+		reflect.DeepEqual(h.NetInfo, h2.NetInfo) &&
+		eqRoutePriorityMap(h.RoutableIPsPriority, h2.RoutableIPsPriority)
+}
+
+// PeerChange is a patch to apply to a Node in a client's in-memory netmap,
+// describing only the fields that changed. NodeID identifies the target
+// node; every other field is nilable and should be left nil to mean "this
+// field did not change". PeerChange lets the control plane publish things
+// like presence flips or endpoint churn without resending the full Node.
+type PeerChange struct {
+	// NodeID identifies the peer being patched. It is required.
+	NodeID NodeID
+
+	// DERP, if non-nil, is the new DERP-in-Go home of this peer.
+	DERP *string `json:",omitempty"`
+
+	// Endpoints, if non-nil, is the new set of known endpoints for this
+	// peer.
+	Endpoints []string `json:",omitempty"`
+
+	// Online, if non-nil, is the new value of Node.Online for this peer.
+	Online *bool `json:",omitempty"`
+
+	// LastSeen, if non-nil, is the new value of Node.LastSeen for this
+	// peer.
+	LastSeen *time.Time `json:",omitempty"`
+}
+
+// CapabilityVersion indicates a client or server's understanding of the
+// wire protocol during capability negotiation. It's incremented each time
+// the protocol gains a capability that older peers can't be assumed to
+// support, so that either side can tell whether it's safe to rely on that
+// capability.
+type CapabilityVersion int
+
+// CurrentCapabilityVersion is the CapabilityVersion of this package.
+const CurrentCapabilityVersion CapabilityVersion = 1
+
+// MapRequest is sent by a client to the control plane to establish or
+// refresh its view of the tailnet.
+type MapRequest struct {
+	Version   int
+	NodeKey   NodeKey
+	DiscoKey  DiscoKey
+	Hostinfo  *Hostinfo
+	Endpoints []string `json:",omitempty"`
+
+	// CapabilityVersion is the maximum protocol capability this client
+	// understands.
+	CapabilityVersion CapabilityVersion
+
+	// Stream, if true, keeps the HTTP response open and streams further
+	// MapResponse values as the tailnet changes.
+	Stream bool
+
+	// OmitPeers, if true, asks the control plane to omit Peers (and the
+	// delta fields) from the MapResponse; used for updating the server's
+	// Hostinfo/Endpoints without fetching a netmap.
+	OmitPeers bool
+}
+
+// MapResponse is the control plane's description of a tailnet, sent in
+// response to a MapRequest.
+type MapResponse struct {
+	Node  *Node
+	Peers []*Node `json:",omitempty"`
+
+	DNS    []string `json:",omitempty"`
+	Domain string   `json:",omitempty"`
+
+	// PeersChanged, if non-empty, is a list of nodes that are new or
+	// changed since the client's cached netmap, to be merged in as an
+	// alternative to resending the entire Peers list.
+	PeersChanged []*Node `json:",omitempty"`
+
+	// PeersRemoved, if non-empty, is a list of node IDs that are no
+	// longer in the tailnet and should be removed from the client's
+	// cached netmap.
+	PeersRemoved []NodeID `json:",omitempty"`
+
+	// PeersChangedPatch, if non-empty, is a list of small per-field diffs
+	// to apply to nodes already present in the client's cached netmap, as
+	// an alternative to resending those nodes in full via Peers or
+	// PeersChanged.
+	PeersChangedPatch []PeerChange `json:",omitempty"`
+
+	// PeersUpdatedAt, if non-nil, records when each peer's information
+	// was last changed, keyed by NodeID. It lets the client coalesce a
+	// burst of PeersChanged/PeersChangedPatch updates for the same node
+	// without re-deriving an ordering from arrival time alone: an update
+	// older than the one already applied for that node is dropped rather
+	// than clobbering newer state.
+	PeersUpdatedAt map[NodeID]time.Time `json:",omitempty"`
+
+	// Seq is this MapResponse's sequence number within the current poll
+	// session. The first response (always full, with non-nil Peers)
+	// establishes the baseline; every response after it, full or
+	// incremental, carries the previous Seq+1. A client that sees
+	// anything else has missed a response and can no longer trust its
+	// cached netmap against PeersChanged/PeersRemoved/PeersChangedPatch,
+	// so it must fall back to requesting a full resync.
+	Seq int64 `json:",omitempty"`
+
+	KeepAlive bool `json:",omitempty"`
+
+	// ServerCapabilityVersion is the maximum protocol capability this
+	// control server understands. Clients use it to tell whether the
+	// server supports capabilities (such as PeersChangedPatch) that the
+	// client wants to rely on.
+	ServerCapabilityVersion CapabilityVersion `json:",omitempty"`
+}
+
+func parseHexKey(b []byte, prefix string) ([32]byte, error) {
+	var k [32]byte
+	s := string(b)
+	if !strings.HasPrefix(s, prefix) {
+		return k, fmt.Errorf("tailcfg: key missing required prefix %q", prefix)
+	}
+	s = strings.TrimPrefix(s, prefix)
+	d, err := hex.DecodeString(s)
+	if err != nil {
+		return k, fmt.Errorf("tailcfg: invalid key: %w", err)
+	}
+	if len(d) != len(k) {
+		return k, fmt.Errorf("tailcfg: invalid key length %d", len(d))
+	}
+	copy(k[:], d)
+	return k, nil
+}
+
+// MachineKey is the curve25519 public key for a machine.
+type MachineKey [32]byte
+
+func (k MachineKey) String() string               { return "mkey:" + hex.EncodeToString(k[:]) }
+func (k MachineKey) MarshalText() ([]byte, error) { return []byte(k.String()), nil }
+func (k *MachineKey) UnmarshalText(b []byte) error {
+	v, err := parseHexKey(b, "mkey:")
+	if err != nil {
+		return err
+	}
+	*k = MachineKey(v)
+	return nil
+}
+
+// NodeKey is the Wireguard public key for a node.
+type NodeKey [32]byte
+
+func (k NodeKey) String() string               { return "nodekey:" + hex.EncodeToString(k[:]) }
+func (k NodeKey) MarshalText() ([]byte, error) { return []byte(k.String()), nil }
+func (k *NodeKey) UnmarshalText(b []byte) error {
+	v, err := parseHexKey(b, "nodekey:")
+	if err != nil {
+		return err
+	}
+	*k = NodeKey(v)
+	return nil
+}
+
+// DiscoKey is the curve25519 public key used for disco (discovery) messages.
+type DiscoKey [32]byte
+
+func (k DiscoKey) String() string               { return "discokey:" + hex.EncodeToString(k[:]) }
+func (k DiscoKey) MarshalText() ([]byte, error) { return []byte(k.String()), nil }
+func (k *DiscoKey) UnmarshalText(b []byte) error {
+	v, err := parseHexKey(b, "discokey:")
+	if err != nil {
+		return err
+	}
+	*k = DiscoKey(v)
+	return nil
+}
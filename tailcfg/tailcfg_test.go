@@ -30,6 +30,7 @@ func TestHostinfoEqual(t *testing.T) {
 		"GoArch",
 		"RoutableIPs", "RequestTags",
 		"Services", "NetInfo",
+		"RoutableIPsPriority",
 	}
 	if have := fieldsOf(reflect.TypeOf(Hostinfo{})); !reflect.DeepEqual(have, hiHandles) {
 		t.Errorf("Hostinfo.Equal check might be out of sync\nfields: %q\nhandled: %q\n",
@@ -178,6 +179,17 @@ func TestHostinfoEqual(t *testing.T) {
 			&Hostinfo{},
 			false,
 		},
+
+		{
+			&Hostinfo{RoutableIPsPriority: map[netaddr.IPPrefix]int{nets("10.0.0.0/16")[0]: 1}},
+			&Hostinfo{RoutableIPsPriority: map[netaddr.IPPrefix]int{nets("10.0.0.0/16")[0]: 2}},
+			false,
+		},
+		{
+			&Hostinfo{RoutableIPsPriority: map[netaddr.IPPrefix]int{nets("10.0.0.0/16")[0]: 1}},
+			&Hostinfo{RoutableIPsPriority: map[netaddr.IPPrefix]int{nets("10.0.0.0/16")[0]: 1}},
+			true,
+		},
 	}
 	for i, tt := range tests {
 		got := tt.a.Equal(tt.b)
@@ -193,6 +205,7 @@ func TestNodeEqual(t *testing.T) {
 		"Key", "KeyExpiry", "Machine", "DiscoKey",
 		"Addresses", "AllowedIPs", "Endpoints", "DERP", "Hostinfo",
 		"Created", "LastSeen", "KeepAlive", "MachineAuthorized",
+		"Online", "IsSubnetRouterPrimary",
 	}
 	if have := fieldsOf(reflect.TypeOf(Node{})); !reflect.DeepEqual(have, nodeHandles) {
 		t.Errorf("Node.Equal check might be out of sync\nfields: %q\nhandled: %q\n",
@@ -359,6 +372,33 @@ func TestNodeEqual(t *testing.T) {
 			&Node{DERP: "bar"},
 			false,
 		},
+
+		{
+			&Node{Online: nil},
+			&Node{Online: new(bool)},
+			false,
+		},
+		{
+			&Node{Online: ptrBool(true)},
+			&Node{Online: ptrBool(false)},
+			false,
+		},
+		{
+			&Node{Online: ptrBool(true)},
+			&Node{Online: ptrBool(true)},
+			true,
+		},
+
+		{
+			&Node{IsSubnetRouterPrimary: true},
+			&Node{IsSubnetRouterPrimary: false},
+			false,
+		},
+		{
+			&Node{IsSubnetRouterPrimary: true},
+			&Node{IsSubnetRouterPrimary: true},
+			true,
+		},
 	}
 	for i, tt := range tests {
 		got := tt.a.Equal(tt.b)
@@ -368,6 +408,22 @@ func TestNodeEqual(t *testing.T) {
 	}
 }
 
+func ptrBool(b bool) *bool { return &b }
+
+func TestPeerChangeFields(t *testing.T) {
+	handled := []string{
+		"NodeID",
+		"DERP",
+		"Endpoints",
+		"Online",
+		"LastSeen",
+	}
+	if have := fieldsOf(reflect.TypeOf(PeerChange{})); !reflect.DeepEqual(have, handled) {
+		t.Errorf("PeerChange fields changed; this test (and the code applying patches) needs an update\nfields: %q\nhandled: %q\n",
+			have, handled)
+	}
+}
+
 func TestNetInfoFields(t *testing.T) {
 	handled := []string{
 		"MappingVariesByDestIP",
@@ -411,6 +467,53 @@ func TestDiscoKeyMarshal(t *testing.T) {
 	testKey(t, "discokey:", k1, &k2)
 }
 
+// wireKeyBytes are the 32 bytes (0x00..0x1f) used by the golden-vector
+// tests below. The wire format for *Key.MarshalText is part of the
+// client/control protocol, so these vectors must never change for a given
+// input without a corresponding protocol version bump.
+func wireKeyBytes() (k [32]byte) {
+	for i := range k {
+		k[i] = byte(i)
+	}
+	return k
+}
+
+func TestMachineKeyMarshalGolden(t *testing.T) {
+	k := MachineKey(wireKeyBytes())
+	const want = "mkey:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	got, err := k.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("MachineKey.MarshalText = %q; want %q", got, want)
+	}
+}
+
+func TestNodeKeyMarshalGolden(t *testing.T) {
+	k := NodeKey(wireKeyBytes())
+	const want = "nodekey:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	got, err := k.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("NodeKey.MarshalText = %q; want %q", got, want)
+	}
+}
+
+func TestDiscoKeyMarshalGolden(t *testing.T) {
+	k := DiscoKey(wireKeyBytes())
+	const want = "discokey:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	got, err := k.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("DiscoKey.MarshalText = %q; want %q", got, want)
+	}
+}
+
 type keyIn interface {
 	String() string
 	MarshalText() ([]byte, error)
@@ -464,6 +567,7 @@ func TestCloneNode(t *testing.T) {
 			AllowedIPs: make([]netaddr.IPPrefix, 0),
 			Endpoints:  make([]string, 0),
 		}},
+		{"online", &Node{Online: ptrBool(true)}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
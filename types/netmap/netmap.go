@@ -0,0 +1,78 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netmap assembles per-tailnet information (such as HA subnet
+// router elections) from the raw tailcfg.Node list in a netmap.
+package netmap
+
+import (
+	"inet.af/netaddr"
+	"tailscale.com/tailcfg"
+)
+
+// PrimaryRoutes picks, for each routed prefix advertised by more than one
+// node, a single primary advertiser: the highest-priority
+// Hostinfo.RoutableIPsPriority entry among the nodes currently Online,
+// breaking ties by the lowest StableID so that all clients converge on the
+// same answer without further control-plane coordination. Nodes are only
+// considered candidates for a prefix if they advertise it in
+// Hostinfo.RoutableIPs.
+//
+// The returned map has one entry per contested-or-not prefix, giving the
+// StableID of the node that should currently be treated as primary.
+func PrimaryRoutes(nodes []*tailcfg.Node) map[netaddr.IPPrefix]tailcfg.StableID {
+	type candidate struct {
+		stableID tailcfg.StableID
+		priority int
+		online   bool
+	}
+	byPrefix := make(map[netaddr.IPPrefix][]candidate)
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		online := n.Online == nil || *n.Online // unknown presence is treated as reachable
+		for _, p := range n.Hostinfo.RoutableIPs {
+			byPrefix[p] = append(byPrefix[p], candidate{
+				stableID: n.StableID,
+				priority: n.Hostinfo.RoutableIPsPriority[p],
+				online:   online,
+			})
+		}
+	}
+
+	primary := make(map[netaddr.IPPrefix]tailcfg.StableID, len(byPrefix))
+	for p, cands := range byPrefix {
+		var best *candidate
+		for i := range cands {
+			c := &cands[i]
+			if !c.online {
+				continue
+			}
+			switch {
+			case best == nil:
+				best = c
+			case c.priority > best.priority:
+				best = c
+			case c.priority == best.priority && c.stableID < best.stableID:
+				best = c
+			}
+		}
+		if best == nil {
+			// No candidate is online; fall back to the lowest StableID so
+			// the prefix still resolves deterministically once one comes
+			// back.
+			for i := range cands {
+				c := &cands[i]
+				if best == nil || c.stableID < best.stableID {
+					best = c
+				}
+			}
+		}
+		if best != nil {
+			primary[p] = best.stableID
+		}
+	}
+	return primary
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netmap
+
+import (
+	"testing"
+
+	"inet.af/netaddr"
+	"tailscale.com/tailcfg"
+)
+
+func mustPrefix(t *testing.T, s string) netaddr.IPPrefix {
+	p, err := netaddr.ParseIPPrefix(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func routerNode(stableID tailcfg.StableID, prefix netaddr.IPPrefix, priority int, online bool) *tailcfg.Node {
+	o := online
+	return &tailcfg.Node{
+		StableID: stableID,
+		Online:   &o,
+		Hostinfo: tailcfg.Hostinfo{
+			RoutableIPs:         []netaddr.IPPrefix{prefix},
+			RoutableIPsPriority: map[netaddr.IPPrefix]int{prefix: priority},
+		},
+	}
+}
+
+func TestPrimaryRoutesPicksHighestPriorityOnlineNode(t *testing.T) {
+	cidr := mustPrefix(t, "10.0.0.0/16")
+	nodes := []*tailcfg.Node{
+		routerNode("node-a", cidr, 1, true),
+		routerNode("node-b", cidr, 2, true),
+	}
+	got := PrimaryRoutes(nodes)
+	if got[cidr] != "node-b" {
+		t.Errorf("primary = %q; want node-b", got[cidr])
+	}
+}
+
+func TestPrimaryRoutesTieBreaksOnStableID(t *testing.T) {
+	cidr := mustPrefix(t, "10.0.0.0/16")
+	nodes := []*tailcfg.Node{
+		routerNode("node-b", cidr, 1, true),
+		routerNode("node-a", cidr, 1, true),
+	}
+	got := PrimaryRoutes(nodes)
+	if got[cidr] != "node-a" {
+		t.Errorf("primary = %q; want node-a", got[cidr])
+	}
+}
+
+func TestPrimaryRoutesFailsOverWhenPrimaryGoesOffline(t *testing.T) {
+	cidr := mustPrefix(t, "10.0.0.0/16")
+	nodes := []*tailcfg.Node{
+		routerNode("node-a", cidr, 2, false),
+		routerNode("node-b", cidr, 1, true),
+	}
+	got := PrimaryRoutes(nodes)
+	if got[cidr] != "node-b" {
+		t.Errorf("primary = %q; want node-b (standby) once node-a is offline", got[cidr])
+	}
+}
+
+func TestPrimaryRoutesAllCandidatesOfflineFallsBackToLowestStableID(t *testing.T) {
+	cidr := mustPrefix(t, "10.0.0.0/16")
+	nodes := []*tailcfg.Node{
+		routerNode("node-b", cidr, 2, false),
+		routerNode("node-a", cidr, 1, false),
+	}
+	got := PrimaryRoutes(nodes)
+	if got[cidr] != "node-a" {
+		t.Errorf("primary = %q; want node-a (lowest StableID) when no candidate is online", got[cidr])
+	}
+}
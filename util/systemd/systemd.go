@@ -0,0 +1,129 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	mu              sync.Mutex // guards fd/addr and each Sendto
+	dialOnce        sync.Once
+	fd              int = -1
+	addr            unix.Sockaddr
+	sockUnavailable bool
+)
+
+// dial opens the unix datagram socket named by $NOTIFY_SOCKET, if set. Each
+// call opens a new socket, so it is only ever called through dialOnce.
+func dial() {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		sockUnavailable = true
+		return
+	}
+	// Sockets starting with "@" refer to the Linux abstract namespace,
+	// where the leading byte is NUL rather than literal "@".
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+	s, err := unix.Socket(unix.AF_UNIX, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		sockUnavailable = true
+		return
+	}
+	fd = s
+	addr = &unix.SockaddrUnix{Name: path}
+}
+
+// Notifyf sends a formatted, newline-joined status update to systemd over
+// $NOTIFY_SOCKET. It is a no-op returning nil if $NOTIFY_SOCKET is unset,
+// which is the case unless tailscaled is run as a systemd service with
+// Type=notify.
+func Notifyf(format string, args ...interface{}) error {
+	dialOnce.Do(dial)
+	if sockUnavailable {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	msg := fmt.Sprintf(format, args...)
+	// MSG_NOSIGNAL: a systemd restart between our Do and this Sendto can
+	// leave nothing listening on the socket; we don't want that to raise
+	// SIGPIPE and take tailscaled down with it.
+	return unix.Sendto(fd, []byte(msg), unix.MSG_NOSIGNAL, addr)
+}
+
+// Ready tells systemd that this process has finished starting up and is
+// ready to serve.
+func Ready() error { return Notifyf("READY=1\nMAINPID=%d", os.Getpid()) }
+
+// Reloading tells systemd that this process is reloading its
+// configuration. Callers should call Ready once the reload is complete.
+func Reloading() error { return Notifyf("RELOADING=1") }
+
+// Stopping tells systemd that this process is beginning a graceful
+// shutdown.
+func Stopping() error { return Notifyf("STOPPING=1") }
+
+// Status sets the single-line status string that `systemctl status`
+// displays for this unit.
+func Status(status string) error { return Notifyf("STATUS=%s", status) }
+
+// WatchdogEnabled reports whether systemd has configured a watchdog for
+// this process, by way of $WATCHDOG_USEC and (if set) $WATCHDOG_PID
+// matching our PID. If so, it returns the configured watchdog interval;
+// callers must send a keepalive notification at least that often.
+func WatchdogEnabled() (interval time.Duration, ok bool) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Microsecond, true
+}
+
+// Watchdog runs healthCheck at half the interval systemd configured via
+// WatchdogEnabled and pets the watchdog (WATCHDOG=1) after each run,
+// returning immediately if no watchdog is configured. It returns when ctx
+// is done. A failing healthCheck is reported to systemd via Status rather
+// than causing Watchdog to stop petting the watchdog or exit; an operator
+// running `systemctl status tailscaled` should see why, and automatic
+// restarts are left to systemd's own watchdog timeout, not this loop.
+func Watchdog(ctx context.Context, healthCheck func() error) {
+	interval, ok := WatchdogEnabled()
+	if !ok {
+		return
+	}
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := healthCheck(); err != nil {
+				Notifyf("STATUS=unhealthy: %v", err)
+			}
+			Notifyf("WATCHDOG=1")
+		}
+	}
+}
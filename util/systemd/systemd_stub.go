@@ -0,0 +1,34 @@
+// Copyright (c) 2020 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package systemd
+
+import (
+	"context"
+	"time"
+)
+
+// Notifyf is a no-op on non-Linux platforms.
+func Notifyf(format string, args ...interface{}) error { return nil }
+
+// Ready is a no-op on non-Linux platforms.
+func Ready() error { return nil }
+
+// Reloading is a no-op on non-Linux platforms.
+func Reloading() error { return nil }
+
+// Stopping is a no-op on non-Linux platforms.
+func Stopping() error { return nil }
+
+// Status is a no-op on non-Linux platforms.
+func Status(status string) error { return nil }
+
+// WatchdogEnabled always reports false on non-Linux platforms.
+func WatchdogEnabled() (interval time.Duration, ok bool) { return 0, false }
+
+// Watchdog is a no-op on non-Linux platforms.
+func Watchdog(ctx context.Context, healthCheck func() error) {}